@@ -0,0 +1,45 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/idtoken"
+)
+
+// requireOIDC wraps next so that it only runs if the request carries a
+// Google-signed OIDC identity token (as Cloud Scheduler attaches to its HTTP
+// targets) whose audience matches audience. This is what lets the runner be
+// deployed as a Cloud Run service that only Cloud Scheduler, via its service
+// account, is authorized to invoke.
+func requireOIDC(audience string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+		if token == "" || token == authHeader {
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		if _, err := idtoken.Validate(r.Context(), token, audience); err != nil {
+			http.Error(w, "invalid identity token", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,34 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "time"
+
+// Config is the e2e-runner configuration, populated from the environment.
+// It describes both how the runner binds (Port) and how its scenarios are
+// locked down and configured (RequireAuth, OIDCAudience, ExportPeriod).
+type Config struct {
+	Port string `env:"PORT, default=8080"`
+
+	// RequireAuth, when true, requires every scenario request to carry a
+	// Google-signed OIDC token (e.g. from Cloud Scheduler) whose audience
+	// matches OIDCAudience. It should only be disabled for local development.
+	RequireAuth  bool   `env:"REQUIRE_AUTH, default=true"`
+	OIDCAudience string `env:"OIDC_AUDIENCE"`
+
+	// ExportPeriod is passed through to the integration harness when it seeds
+	// the default export config used by the scenarios below.
+	ExportPeriod time.Duration `env:"EXPORT_PERIOD, default=1h"`
+}
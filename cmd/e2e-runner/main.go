@@ -0,0 +1,140 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// e2e-runner exposes the same publish -> export -> verify -> cleanup
+// scenarios that the internal/integration tests run under `go test` as a
+// long-running HTTP service, so they can instead be scheduled by Cloud
+// Scheduler as a synthetic probe against a deployed environment.
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+
+	"github.com/google/exposure-notifications-server/internal/integration"
+	"github.com/google/exposure-notifications-server/internal/server"
+)
+
+func main() {
+	ctx := context.Background()
+
+	if err := realMain(ctx); err != nil {
+		log.Fatalf("e2e-runner: %v", err)
+	}
+}
+
+func realMain(ctx context.Context) error {
+	var config Config
+	if err := envconfig.Process(ctx, &config); err != nil {
+		return err
+	}
+
+	if err := registerViews(); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, s := range scenarios {
+		mux.Handle(s.path, scenarioHandler(s, &config))
+	}
+
+	var handler http.Handler = mux
+	if config.RequireAuth {
+		handler = requireOIDC(config.OIDCAudience, handler)
+	}
+
+	srv, err := server.New(config.Port)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("e2e-runner listening on %s", srv.Addr())
+	return srv.ServeHTTPHandler(ctx, handler)
+}
+
+// scenario describes one synthetic end-to-end probe that the runner can be
+// asked to execute on demand.
+type scenario struct {
+	name string
+	path string
+	run  func(ctx context.Context, tb *runnerTB, config *Config) error
+}
+
+var scenarios = []scenario{
+	{name: "default", path: "/default", run: runDefaultScenario},
+	{name: "revise", path: "/revise", run: runReviseScenario},
+	{name: "export-verify", path: "/export-verify", run: runExportVerifyScenario},
+}
+
+func scenarioHandler(s scenario, config *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		err := runScenario(r.Context(), s, config)
+		recordScenario(r.Context(), s.name, start, err)
+
+		if err != nil {
+			log.Printf("scenario %q failed: %v", s.name, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// runScenario recovers the fatalErr panic that the integration harness's
+// TB.Fatal raises on setup failure, turning it back into a plain error, and
+// always runs the harness's registered cleanups afterwards.
+func runScenario(ctx context.Context, s scenario, config *Config) (err error) {
+	tb := &runnerTB{}
+	defer tb.runCleanups()
+	defer func() {
+		if r := recover(); r != nil {
+			if fe, ok := r.(fatalErr); ok {
+				err = fe.err
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	return s.run(ctx, tb, config)
+}
+
+// runDefaultScenario exercises the bare publish -> export -> cleanup path
+// used by the majority of integration tests today.
+func runDefaultScenario(ctx context.Context, tb *runnerTB, config *Config) error {
+	integration.RunDefault(tb, ctx, config.ExportPeriod)
+	return nil
+}
+
+// runReviseScenario additionally exercises re-publishing revised keys.
+func runReviseScenario(ctx context.Context, tb *runnerTB, config *Config) error {
+	integration.RunRevise(tb, ctx, config.ExportPeriod)
+	return nil
+}
+
+// runExportVerifyScenario exercises the export file signature verification
+// path.
+func runExportVerifyScenario(ctx context.Context, tb *runnerTB, config *Config) error {
+	integration.RunExportVerify(tb, ctx, config.ExportPeriod)
+	return nil
+}
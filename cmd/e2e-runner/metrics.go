@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+const metricsPrefix = "e2e-runner"
+
+var (
+	scenarioLatencyMs = stats.Float64(metricsPrefix+"/scenario_latency", "Scenario run latency in milliseconds", stats.UnitMilliseconds)
+	scenarioSuccess   = stats.Int64(metricsPrefix+"/scenario_success_count", "Count of successful scenario runs", stats.UnitDimensionless)
+	scenarioFailure   = stats.Int64(metricsPrefix+"/scenario_failure_count", "Count of failed scenario runs", stats.UnitDimensionless)
+)
+
+// scenarioKey tags every measurement with the scenario name (e.g. "default",
+// "revise", "export-verify") so the three are distinguishable in the
+// exported time series.
+var scenarioKey = tag.MustNewKey("scenario")
+
+func registerViews() error {
+	return view.Register(
+		&view.View{
+			Name:        metricsPrefix + "/scenario_latency_distribution",
+			Measure:     scenarioLatencyMs,
+			Description: "Distribution of scenario run latencies",
+			TagKeys:     []tag.Key{scenarioKey},
+			Aggregation: view.Distribution(0, 100, 250, 500, 1000, 2500, 5000, 10000, 30000),
+		},
+		&view.View{
+			Name:        metricsPrefix + "/scenario_success_count",
+			Measure:     scenarioSuccess,
+			Description: "Count of successful scenario runs",
+			TagKeys:     []tag.Key{scenarioKey},
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        metricsPrefix + "/scenario_failure_count",
+			Measure:     scenarioFailure,
+			Description: "Count of failed scenario runs",
+			TagKeys:     []tag.Key{scenarioKey},
+			Aggregation: view.Count(),
+		},
+	)
+}
+
+// recordScenario records the outcome and latency of a single scenario run.
+func recordScenario(ctx context.Context, scenario string, start time.Time, err error) {
+	ctx, tagErr := tag.New(ctx, tag.Insert(scenarioKey, scenario))
+	if tagErr != nil {
+		return
+	}
+
+	stats.Record(ctx, scenarioLatencyMs.M(float64(time.Since(start).Milliseconds())))
+	if err != nil {
+		stats.Record(ctx, scenarioFailure.M(1))
+		return
+	}
+	stats.Record(ctx, scenarioSuccess.M(1))
+}
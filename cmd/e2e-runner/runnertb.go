@@ -0,0 +1,58 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// fatalErr is a sentinel panic value raised by runnerTB.Fatal and recovered
+// by runScenario, converting a harness-construction failure into a plain
+// Go error instead of killing the process (which is what testing.TB.Fatal
+// would do via runtime.Goexit).
+type fatalErr struct{ err error }
+
+// runnerTB adapts the non-test lifecycle of the e2e-runner to the minimal
+// integration.TB interface, so the same harness construction code used by
+// `go test` can be driven on every incoming scenario request.
+type runnerTB struct {
+	cleanups []func()
+}
+
+func (r *runnerTB) Helper() {}
+
+func (r *runnerTB) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+// Error logs args. Unlike testing.TB.Error, it does not mark the scenario
+// as failed.
+func (r *runnerTB) Error(args ...interface{}) {
+	log.Print(args...)
+}
+
+func (r *runnerTB) Fatal(args ...interface{}) {
+	panic(fatalErr{err: errors.New(fmt.Sprint(args...))})
+}
+
+// runCleanups runs the registered cleanup functions in LIFO order, matching
+// testing.TB's documented Cleanup semantics.
+func (r *runnerTB) runCleanups() {
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		r.cleanups[i]()
+	}
+}
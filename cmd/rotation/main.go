@@ -0,0 +1,83 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// rotation periodically rotates the KMS-backed export signing keys, via an
+// HTTP endpoint intended to be invoked on a Cloud Scheduler cron.
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+
+	"github.com/google/exposure-notifications-server/internal/database"
+	"github.com/google/exposure-notifications-server/internal/rotation"
+	"github.com/google/exposure-notifications-server/internal/server"
+	"github.com/google/exposure-notifications-server/internal/setup"
+	"github.com/google/exposure-notifications-server/pkg/keys"
+	"github.com/google/exposure-notifications-server/pkg/secrets"
+)
+
+type config struct {
+	Port          string          `env:"PORT, default=8080"`
+	Database      database.Config `env:", prefix=DB_"`
+	SecretManager secrets.Config  `env:", prefix=SECRET_"`
+	KeyManager    keys.Config     `env:", prefix=KEY_"`
+
+	Timeout        time.Duration `env:"ROTATION_TIMEOUT, default=10m"`
+	KeyMaxAge      time.Duration `env:"KEY_MAX_AGE, default=168h"`
+	KeyGracePeriod time.Duration `env:"KEY_GRACE_PERIOD, default=24h"`
+}
+
+func main() {
+	ctx := context.Background()
+
+	if err := realMain(ctx); err != nil {
+		log.Fatalf("rotation: %v", err)
+	}
+}
+
+func realMain(ctx context.Context) error {
+	var cfg config
+	if err := envconfig.Process(ctx, &cfg); err != nil {
+		return err
+	}
+
+	env, closer, err := setup.Setup(ctx, &cfg)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	rotationConfig := &rotation.Config{
+		Timeout:        cfg.Timeout,
+		KeyMaxAge:      cfg.KeyMaxAge,
+		KeyGracePeriod: cfg.KeyGracePeriod,
+	}
+
+	handler, err := rotation.NewHandler(rotationConfig, env)
+	if err != nil {
+		return err
+	}
+
+	srv, err := server.New(cfg.Port)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("rotation service listening on %s", srv.Addr())
+	return srv.ServeHTTPHandler(ctx, handler)
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jwt"
+
+	"github.com/google/exposure-notifications-server/internal/publish"
+)
+
+const (
+	attestationIssuer      = "https://attestation.example.com"
+	attestationAudience    = "https://publish.example.com"
+	attestationMeasurement = "sha256:test-workload-measurement"
+)
+
+// testAttestationSigner mints attestation tokens with a throwaway RSA key,
+// so integration tests can exercise the accept/reject/expired/nonce-mismatch
+// paths of publish.RequireAttestation without a real attestation service.
+type testAttestationSigner struct {
+	key *rsa.PrivateKey
+}
+
+// newTestAttestationHarness generates a throwaway signing key, returning
+// both a publish.AttestationVerifier configured to trust it and a signer
+// tests can use to mint tokens.
+func newTestAttestationHarness(tb TB) (publish.AttestationVerifier, *testAttestationSigner) {
+	tb.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	pub, err := jwk.New(&key.PublicKey)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := pub.Set(jwk.AlgorithmKey, jwa.RS256); err != nil {
+		tb.Fatal(err)
+	}
+	if err := pub.Set(jwk.KeyIDKey, "test-attestation-key"); err != nil {
+		tb.Fatal(err)
+	}
+
+	keySet := jwk.NewSet()
+	keySet.Add(pub)
+
+	verifier := &publish.JWKSAttestationVerifier{
+		KeySet:              keySet,
+		Issuer:              attestationIssuer,
+		Audience:            attestationAudience,
+		AllowedMeasurements: map[string]struct{}{attestationMeasurement: {}},
+	}
+
+	return verifier, &testAttestationSigner{key: key}
+}
+
+// newAttestationTestServer sets up a test server with publish.RequireAttestation
+// forced on, regardless of HarnessConfig.RequireAttestation, so tests can
+// exercise the accept/reject/expired/nonce-mismatch paths of the real
+// /publish handler hermetically instead of only unit-testing
+// JWKSAttestationVerifier in isolation.
+func newAttestationTestServer(tb TB, ctx context.Context) (*EnServerClient, *testAttestationSigner) {
+	tb.Helper()
+
+	runFolder := newRunFolder(tb)
+	env, client, signer := testServer(tb, runFolder, true)
+	startAuthorizedApp(ctx, env, tb)
+
+	return &EnServerClient{client: client}, signer
+}
+
+// Sign mints an attestation token for the given nonce (the sha256 of the
+// publish request body), expiring after ttl. Passing a ttl <= 0 mints an
+// already-expired token, for testing the expired-token rejection path.
+func (s *testAttestationSigner) Sign(nonce string, ttl time.Duration) (string, error) {
+	token := jwt.New()
+	if err := token.Set(jwt.IssuerKey, attestationIssuer); err != nil {
+		return "", err
+	}
+	if err := token.Set(jwt.AudienceKey, attestationAudience); err != nil {
+		return "", err
+	}
+	if err := token.Set(jwt.ExpirationKey, time.Now().Add(ttl)); err != nil {
+		return "", err
+	}
+	if err := token.Set("measurement", attestationMeasurement); err != nil {
+		return "", err
+	}
+	if err := token.Set("nonce", nonce); err != nil {
+		return "", err
+	}
+
+	signed, err := jwt.Sign(token, jwa.RS256, s.key)
+	if err != nil {
+		return "", fmt.Errorf("signing attestation token: %w", err)
+	}
+	return string(signed), nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// requestNonce is the sha256 hex digest publish.RequireAttestation expects
+// an attestation token's nonce claim to echo for req, computed the same way
+// postJSON marshals it so the signed token matches byte-for-byte.
+func requestNonce(t *testing.T, keys []string, startInterval int32) string {
+	t.Helper()
+
+	b, err := json.Marshal(publishRequest(keys, startInterval))
+	if err != nil {
+		t.Fatalf("marshaling publish request: %v", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// TestAttestationGatedPublish drives the real /publish handler behind
+// publish.RequireAttestation (forced on via newAttestationTestServer,
+// independent of HarnessConfig.RequireAttestation) through its
+// accept/reject/expired/nonce-mismatch paths, using
+// newTestAttestationHarness's signer to mint tokens. The unit-level
+// coverage in internal/publish/attestation_test.go exercises
+// RequireAttestation and JWKSAttestationVerifier in front of a stub handler;
+// this covers the harness's wiring of them into an actual running server.
+func TestAttestationGatedPublish(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	enClient, signer := newAttestationTestServer(t, ctx)
+
+	const startInterval = 2650847
+	nonce := requestNonce(t, []string{testKey}, startInterval)
+
+	t.Run("accept", func(t *testing.T) {
+		token, err := signer.Sign(nonce, time.Minute)
+		if err != nil {
+			t.Fatalf("signing attestation token: %v", err)
+		}
+		if err := enClient.PublishWithAttestation(ctx, []string{testKey}, startInterval, token); err != nil {
+			t.Errorf("expected a validly attested publish to succeed, got: %v", err)
+		}
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		if err := enClient.PublishWithAttestation(ctx, []string{testKey}, startInterval, ""); err == nil {
+			t.Error("expected a publish with no attestation token to be rejected")
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		token, err := signer.Sign(nonce, -time.Minute)
+		if err != nil {
+			t.Fatalf("signing expired attestation token: %v", err)
+		}
+		if err := enClient.PublishWithAttestation(ctx, []string{testKey}, startInterval, token); err == nil {
+			t.Error("expected a publish with an expired attestation token to be rejected")
+		}
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		token, err := signer.Sign("not-the-request-nonce", time.Minute)
+		if err != nil {
+			t.Fatalf("signing mismatched-nonce attestation token: %v", err)
+		}
+		if err := enClient.PublishWithAttestation(ctx, []string{testKey}, startInterval, token); err == nil {
+			t.Error("expected a publish whose attestation token nonce doesn't match the body to be rejected")
+		}
+	})
+}
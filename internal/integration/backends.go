@@ -0,0 +1,128 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/google/exposure-notifications-server/internal/database"
+	"github.com/google/exposure-notifications-server/internal/storage"
+	"github.com/google/exposure-notifications-server/pkg/keys"
+	"github.com/google/exposure-notifications-server/pkg/secrets"
+)
+
+// newRunFolder returns a short, random folder name unique to one harness
+// run, so that concurrent runs against the same real bucket (and a run's
+// own cleanup) stay scoped to the objects that run created instead of
+// colliding with -- or wiping -- everything else in the bucket.
+func newRunFolder(tb TB) string {
+	tb.Helper()
+
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		tb.Fatal(err)
+	}
+	return fmt.Sprintf("%s/run-%s", exportDir, hex.EncodeToString(b[:]))
+}
+
+// newStorage returns the blob storage backend described by config, mocked
+// by default and GCS when config.Storage == "gcs". Only the objects under
+// runFolder -- the folder this run's export config writes into -- are
+// removed on cleanup, never the whole bucket.
+func newStorage(ctx context.Context, config *HarnessConfig, runFolder string, tb TB) storage.Blobstore {
+	tb.Helper()
+
+	if config.Storage != "gcs" {
+		bs, err := storage.NewMemory(ctx)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		return bs
+	}
+
+	bs, err := storage.NewGoogleCloudStorage(ctx)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		if err := bs.DeleteObjectsInFolder(context.Background(), config.Bucket, runFolder); err != nil {
+			tb.Fatal(err)
+		}
+	})
+	return bs
+}
+
+// newDatabase returns the database backend described by config: an
+// ephemeral, auto-closed test database by default, or a connection to
+// config.DBURL when set. In the latter case the database is left running;
+// NewTestServer deletes only the signature_info and export_config rows it
+// created, and other rows the run writes are left in place.
+func newDatabase(ctx context.Context, config *HarnessConfig, tb TB) *database.DB {
+	tb.Helper()
+
+	if config.DBURL == "" {
+		return database.NewTestDatabase(tb)
+	}
+
+	db, err := database.NewFromURL(ctx, config.DBURL)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(db.Close)
+	return db
+}
+
+// newKeyManager returns the key manager backend described by config: noop
+// by default, or Cloud KMS when config.KMS == "gcp".
+func newKeyManager(ctx context.Context, config *HarnessConfig, tb TB) keys.KeyManager {
+	tb.Helper()
+
+	if config.KMS != "gcp" {
+		km, err := keys.NewNoop(ctx)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		return km
+	}
+
+	km, err := keys.NewGoogleCloudKMS(ctx)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return km
+}
+
+// newSecretManager returns the secret manager backend described by config:
+// noop by default, or Secret Manager when config.Secrets == "gsm".
+func newSecretManager(ctx context.Context, config *HarnessConfig, tb TB) secrets.SecretManager {
+	tb.Helper()
+
+	if config.Secrets != "gsm" {
+		sm, err := secrets.NewNoop(ctx)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		return sm
+	}
+
+	sm, err := secrets.NewGoogleSecretManager(ctx)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return sm
+}
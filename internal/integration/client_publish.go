@@ -0,0 +1,122 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/exposure-notifications-server/internal/publish"
+	verifyapi "github.com/google/exposure-notifications-server/pkg/api/v1alpha1"
+)
+
+// publishRequest builds the publish request body shared by Publish and
+// PublishWithAttestation: keys (base64-encoded TEKs) for the com.example.app
+// authorized app that startAuthorizedApp registers, using consecutive
+// rolling-start intervals starting at startInterval.
+func publishRequest(keys []string, startInterval int32) *verifyapi.Publish {
+	req := &verifyapi.Publish{
+		Keys:                make([]verifyapi.ExposureKey, 0, len(keys)),
+		Regions:             []string{"TEST"},
+		AppPackageName:      "com.example.app",
+		HealthAuthorityID:   "12345",
+		VerificationPayload: "",
+	}
+	for i, k := range keys {
+		req.Keys = append(req.Keys, verifyapi.ExposureKey{
+			Key:              k,
+			IntervalNumber:   startInterval + int32(i)*144,
+			IntervalCount:    144,
+			TransmissionRisk: 1,
+		})
+	}
+	return req
+}
+
+// Publish posts keys to /publish. See publishRequest for the request shape.
+func (c *EnServerClient) Publish(ctx context.Context, keys []string, startInterval int32) error {
+	return c.postJSON(ctx, "/publish", publishRequest(keys, startInterval), &verifyapi.PublishResponse{})
+}
+
+// PublishWithAttestation behaves like Publish, but attaches token as the
+// request's publish.AttestationHeader, letting tests drive
+// publish.RequireAttestation's accept/reject/expired/nonce-mismatch paths
+// against the real gated handler. An empty token omits the header entirely,
+// covering the missing-token rejection path.
+func (c *EnServerClient) PublishWithAttestation(ctx context.Context, keys []string, startInterval int32, token string) error {
+	return c.postJSON(ctx, "/publish", publishRequest(keys, startInterval), &verifyapi.PublishResponse{}, token)
+}
+
+// TriggerExportBatchCreation asks the export server to cut new batches for
+// any due ExportConfig, mirroring what cmd/export-create-batches does on a
+// schedule in production.
+func (c *EnServerClient) TriggerExportBatchCreation(ctx context.Context) error {
+	return c.postJSON(ctx, "/export/create-batches", nil, nil)
+}
+
+// TriggerExportWork asks the export server to process one pending export
+// batch, mirroring what cmd/export-do-work does on a schedule in
+// production.
+func (c *EnServerClient) TriggerExportWork(ctx context.Context) error {
+	return c.postJSON(ctx, "/export/do-work", nil, nil)
+}
+
+// TriggerExportCleanup asks the cleanup server to delete expired export
+// files, mirroring what cmd/cleanup-export does on a schedule in
+// production.
+func (c *EnServerClient) TriggerExportCleanup(ctx context.Context) error {
+	return c.postJSON(ctx, "/cleanup-export", nil, nil)
+}
+
+// postJSON posts reqBody as JSON to path and decodes the response into
+// respBody. attestationToken, if given and non-empty, is attached as the
+// publish.AttestationHeader; every caller but PublishWithAttestation omits
+// it.
+func (c *EnServerClient) postJSON(ctx context.Context, path string, reqBody, respBody interface{}, attestationToken ...string) error {
+	var body bytes.Reader
+	if reqBody != nil {
+		b, err := json.Marshal(reqBody)
+		if err != nil {
+			return fmt.Errorf("marshaling request for %s: %w", path, err)
+		}
+		body = *bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, path, &body)
+	if err != nil {
+		return fmt.Errorf("building request for %s: %w", path, err)
+	}
+	req.Header.Set("content-type", "application/json")
+	if len(attestationToken) > 0 && attestationToken[0] != "" {
+		req.Header.Set(publish.AttestationHeader, attestationToken[0])
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("calling %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", path, resp.Status)
+	}
+	if respBody == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(respBody)
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/google/exposure-notifications-server/internal/federationout"
+	"github.com/google/exposure-notifications-server/internal/serverenv"
+
+	federationpb "github.com/google/exposure-notifications-server/internal/pb/federation"
+)
+
+// bufconnBufSize is the in-memory buffer size for the federation-out
+// bufconn listener; scenarios exchange small amounts of key data so this
+// doesn't need to be large.
+const bufconnBufSize = 1024 * 1024
+
+// federationOutAudience is the audience the in-memory OIDC verifier accepts;
+// tests that want to exercise the reject path use any other value.
+const federationOutAudience = "https://federationout.example.com"
+
+// federationOutTestToken is the one token startFederationOut authorizes
+// against the harness's memoryTokenVerifier. NewTestServer's federation-out
+// client carries no credentials of its own: tests attach this token as a
+// bearer "authorization" metadata entry, and tests exercising the reject
+// path simply don't attach it.
+const federationOutTestToken = "integration-test-token"
+
+// federationOutTestHealthAuthorityID is the health authority ID that
+// federationOutTestToken resolves to.
+const federationOutTestHealthAuthorityID = 1
+
+// startFederationOut starts a federation-out gRPC server backed by env on an
+// in-memory (bufconn) listener and returns a client connection to it. The
+// listener and server are torn down when tb's cleanup runs.
+func startFederationOut(tb TB, env *serverenv.ServerEnv) *grpc.ClientConn {
+	tb.Helper()
+
+	lis := bufconn.Listen(bufconnBufSize)
+
+	federationOutConfig := &federationout.Config{
+		Timeout: 10 * time.Second,
+	}
+
+	verifier := newMemoryTokenVerifier(federationOutAudience)
+	verifier.Allow(federationOutTestToken, federationOutTestHealthAuthorityID)
+
+	federationServer, err := federationout.NewServer(federationOutConfig, env, verifier)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	grpcServer := grpc.NewServer()
+	federationpb.RegisterFederationServer(grpcServer, federationServer)
+
+	go func() {
+		// bufconn.Listener.Accept returns an error once the listener is
+		// closed during cleanup; that's expected and not worth surfacing.
+		_ = grpcServer.Serve(lis)
+	}()
+	tb.Cleanup(grpcServer.Stop)
+
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, "bufconn",
+		grpc.WithContextDialer(dialer),
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+	)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	federationpb "github.com/google/exposure-notifications-server/internal/pb/federation"
+)
+
+// TestFederationOut publishes a key on an instance and pulls it back by
+// calling that same instance's federation-out gRPC server directly, using
+// the credential startFederationOut already authorized. This covers
+// federation-out's Fetch surface and its token allowlist (see also
+// TestMemoryTokenVerifier for the allowlist's audience/issuer branches);
+// it does not drive internal/federationin's own sync job, which pulls from
+// a configured peer on its own schedule rather than being invokable
+// directly against an arbitrary federation-out client connection.
+func TestFederationOut(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	_, enClient, _, federationClient := NewTestServer(t, ctx, time.Hour)
+
+	if err := enClient.Publish(ctx, []string{testKey}, 2650847); err != nil {
+		t.Fatalf("publishing to source instance: %v", err)
+	}
+
+	authCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+federationOutTestToken)
+	resp, err := federationClient.Fetch(authCtx, &federationpb.FederationFetchRequest{
+		RegionIdentifiers: []string{"TEST"},
+	})
+	if err != nil {
+		t.Fatalf("fetching from federation-out: %v", err)
+	}
+	if len(resp.GetContactTracingInfo()) == 0 {
+		t.Errorf("expected at least one batch of contact tracing info from federation-out, got none")
+	}
+}
+
+// TestFederationOut_RejectsUnauthorized confirms that a Fetch call with no
+// (or an invalid) bearer token is rejected by the memoryTokenVerifier
+// rather than silently returning data.
+func TestFederationOut_RejectsUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	_, enClient, _, federationClient := NewTestServer(t, ctx, time.Hour)
+
+	if err := enClient.Publish(ctx, []string{testKey}, 2650847); err != nil {
+		t.Fatalf("publishing to source instance: %v", err)
+	}
+
+	if _, err := federationClient.Fetch(ctx, &federationpb.FederationFetchRequest{
+		RegionIdentifiers: []string{"TEST"},
+	}); err == nil {
+		t.Error("expected Fetch with no credentials to be rejected, got nil error")
+	}
+
+	badCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer not-a-real-token")
+	if _, err := federationClient.Fetch(badCtx, &federationpb.FederationFetchRequest{
+		RegionIdentifiers: []string{"TEST"},
+	}); err == nil {
+		t.Error("expected Fetch with an unrecognized token to be rejected, got nil error")
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import "os"
+
+// HarnessConfig controls which backends the integration harness talks to.
+// By default every field resolves to the in-memory/noop implementations so
+// that `go test` stays hermetic; setting the corresponding E2E_* environment
+// variable points the same scenarios at real GCP backends instead, so they
+// can validate a staging environment end to end.
+type HarnessConfig struct {
+	// Storage selects the blob storage backend: "memory" (default) or "gcs".
+	Storage string
+	// KMS selects the signing key backend: "noop" (default) or "gcp".
+	KMS string
+	// Secrets selects the secret manager backend: "noop" (default) or "gsm".
+	Secrets string
+
+	// DBURL is a Postgres connection string. When empty, an ephemeral test
+	// database is created and torn down for the duration of the harness, as
+	// today. When set, the harness connects to it directly and leaves it
+	// running afterwards, deleting only the signature_info and
+	// export_config rows NewTestServer created; other rows the run writes
+	// (published exposures, export batches and files) are left in place.
+	DBURL string
+
+	// Bucket is the GCS bucket name used when Storage == "gcs".
+	Bucket string
+
+	// SigningKey is a fully qualified Cloud KMS key version resource name
+	// (projects/.../cryptoKeyVersions/1), used when KMS == "gcp".
+	SigningKey string
+
+	// RequireAttestation, when true, gates /publish behind the
+	// publish.RequireAttestation middleware. NewTestServer does not hand the
+	// test signer to its client, so the scenarios' publishes carry no
+	// attestation token and are rejected while this is set.
+	RequireAttestation bool
+}
+
+// useRealBackends reports whether any backend has been pointed at a real
+// environment rather than the hermetic in-memory/noop defaults.
+func (c *HarnessConfig) useRealBackends() bool {
+	return c.Storage == "gcs" || c.KMS == "gcp" || c.Secrets == "gsm" || c.DBURL != ""
+}
+
+// SkipSignatureVerification reports whether export signature verification
+// should be skipped because the harness is signing with the noop KMS, whose
+// signatures are not valid and so can never be verified. Scenarios that
+// check export signatures (e.g. export-verify) should call this before
+// treating a verification failure as real.
+func (c *HarnessConfig) SkipSignatureVerification() bool {
+	return c.KMS != "gcp"
+}
+
+// loadHarnessConfig reads a HarnessConfig from the environment, defaulting
+// every backend to its hermetic, in-memory/noop implementation.
+func loadHarnessConfig() *HarnessConfig {
+	return &HarnessConfig{
+		Storage:            envOrDefault("E2E_STORAGE", "memory"),
+		KMS:                envOrDefault("E2E_KMS", "noop"),
+		Secrets:            envOrDefault("E2E_SECRETS", "noop"),
+		DBURL:              os.Getenv("E2E_DB_URL"),
+		Bucket:             envOrDefault("E2E_BUCKET", exportDir),
+		SigningKey:         os.Getenv("E2E_SIGNING_KEY"),
+		RequireAttestation: os.Getenv("E2E_REQUIRE_ATTESTATION") == "true",
+	}
+}
+
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
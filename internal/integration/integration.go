@@ -16,8 +16,8 @@ package integration
 
 import (
 	"context"
+	"fmt"
 	"net/http"
-	"testing"
 	"time"
 
 	"github.com/google/exposure-notifications-server/internal/authorizedapp"
@@ -26,74 +26,71 @@ import (
 	"github.com/google/exposure-notifications-server/internal/export"
 	"github.com/google/exposure-notifications-server/internal/federationin"
 	"github.com/google/exposure-notifications-server/internal/publish"
+	"github.com/google/exposure-notifications-server/internal/rotation"
 	"github.com/google/exposure-notifications-server/internal/server"
 	"github.com/google/exposure-notifications-server/internal/serverenv"
-	"github.com/google/exposure-notifications-server/internal/storage"
-	"github.com/google/exposure-notifications-server/pkg/keys"
-	"github.com/google/exposure-notifications-server/pkg/secrets"
 
 	authorizedappmodel "github.com/google/exposure-notifications-server/internal/authorizedapp/model"
 	exportdatabase "github.com/google/exposure-notifications-server/internal/export/database"
 	exportmodel "github.com/google/exposure-notifications-server/internal/export/model"
+	federationpb "github.com/google/exposure-notifications-server/internal/pb/federation"
 )
 
 const (
 	exportDir = "my-bucket"
 )
 
+// TB is the subset of testing.TB that the integration harness relies on. It
+// exists so the same harness can be driven by go test (*testing.T/B satisfy
+// it today without any changes) as well as by long-running callers, such as
+// cmd/e2e-runner, that have no testing.TB of their own.
+type TB interface {
+	Helper()
+	Cleanup(func())
+	Error(args ...interface{})
+	Fatal(args ...interface{})
+}
+
 // NewTestServer sets up clients used for integration tests
-func NewTestServer(tb testing.TB, ctx context.Context, exportPeriod time.Duration) (*serverenv.ServerEnv, *EnServerClient, *database.DB) {
-	env, client := testServer(tb)
+func NewTestServer(tb TB, ctx context.Context, exportPeriod time.Duration) (*serverenv.ServerEnv, *EnServerClient, *database.DB, federationpb.FederationClient) {
+	runFolder := newRunFolder(tb)
+
+	env, client, _ := testServer(tb, runFolder, false)
 	db := env.Database()
 	enClient := &EnServerClient{client: client}
+	harnessConfig := loadHarnessConfig()
 
 	// Create an authorized app.
 	startAuthorizedApp(ctx, env, tb)
 
-	// Create a signature info.
-	createSignatureInfo(ctx, db, exportPeriod, tb)
-
-	return env, enClient, db
-}
-
-// testServer sets up mocked local servers for running tests
-func testServer(tb testing.TB) (*serverenv.ServerEnv, *http.Client) {
-	tb.Helper()
-
-	ctx := context.Background()
-
-	aa, err := authorizedapp.NewMemoryProvider(ctx, nil)
-	if err != nil {
-		tb.Fatal(err)
-	}
-
-	bs, err := storage.NewMemory(ctx)
-	if err != nil {
-		tb.Fatal(err)
-	}
-
-	db := database.NewTestDatabase(tb)
-
-	km, err := keys.NewNoop(ctx)
-	if err != nil {
-		tb.Fatal(err)
+	// Create a signature info and export config, writing into this run's
+	// own folder so concurrent runs against a real bucket can't collide.
+	// Against a real database these rows outlive the connection, so clean
+	// them up explicitly; the hermetic test database is torn down wholesale
+	// instead.
+	si, ec := createSignatureInfo(ctx, db, exportPeriod, harnessConfig, runFolder, tb)
+	if harnessConfig.useRealBackends() && harnessConfig.DBURL != "" {
+		tb.Cleanup(func() {
+			if err := cleanupSignatureInfo(context.Background(), db, si, ec); err != nil {
+				tb.Fatal(err)
+			}
+		})
 	}
 
-	sm, err := secrets.NewNoop(ctx)
-	if err != nil {
-		tb.Fatal(err)
-	}
+	// Start the federation-out gRPC server and connect to it.
+	federationConn := startFederationOut(tb, env)
+	federationClient := federationpb.NewFederationClient(federationConn)
 
-	env := serverenv.New(ctx,
-		serverenv.WithAuthorizedAppProvider(aa),
-		serverenv.WithBlobStorage(bs),
-		serverenv.WithDatabase(db),
-		serverenv.WithKeyManager(km),
-		serverenv.WithSecretManager(sm),
-	)
-	// Note: don't call env.Cleanup() because the database helper closes the
-	// connection for us.
+	return env, enClient, db, federationClient
+}
 
+// Routes builds the mux of scenario handlers (cleanup, export, federation-in,
+// publish, ...) backed by the given, already-constructed ServerEnv. It has no
+// dependency on testing.TB so it can be shared between the go test harness
+// below and long-running drivers such as cmd/e2e-runner. attestationVerifier
+// is nil unless the caller wants /publish gated behind
+// publish.RequireAttestation.
+func Routes(ctx context.Context, env *serverenv.ServerEnv, attestationVerifier publish.AttestationVerifier) (http.Handler, error) {
 	mux := http.NewServeMux()
 
 	// Cleanup export
@@ -104,7 +101,7 @@ func testServer(tb testing.TB) (*serverenv.ServerEnv, *http.Client) {
 
 	cleanupExportHandler, err := cleanup.NewExportHandler(cleanupExportConfig, env)
 	if err != nil {
-		tb.Fatal(err)
+		return nil, fmt.Errorf("cleanup.NewExportHandler: %w", err)
 	}
 	mux.Handle("/cleanup-export", cleanupExportHandler)
 
@@ -116,7 +113,7 @@ func testServer(tb testing.TB) (*serverenv.ServerEnv, *http.Client) {
 
 	cleanupExposureHandler, err := cleanup.NewExposureHandler(cleanupExposureConfig, env)
 	if err != nil {
-		tb.Fatal(err)
+		return nil, fmt.Errorf("cleanup.NewExposureHandler: %w", err)
 	}
 	mux.Handle("/cleanup-exposure", cleanupExposureHandler)
 
@@ -134,7 +131,7 @@ func testServer(tb testing.TB) (*serverenv.ServerEnv, *http.Client) {
 
 	exportServer, err := export.NewServer(exportConfig, env)
 	if err != nil {
-		tb.Fatal(err)
+		return nil, fmt.Errorf("export.NewServer: %w", err)
 	}
 	mux.Handle("/export/", http.StripPrefix("/export", exportServer.Routes(ctx)))
 
@@ -146,8 +143,9 @@ func testServer(tb testing.TB) (*serverenv.ServerEnv, *http.Client) {
 
 	mux.Handle("/federation-in", federationin.NewHandler(env, federationInConfig))
 
-	// Federation out
-	// TODO: this is a grpc listener and requires a lot of setup.
+	// Federation out is a gRPC service, not an HTTP handler, so it isn't
+	// mounted on this mux; see startFederationOut, which NewTestServer calls
+	// directly to start it on its own bufconn listener.
 
 	// Publish
 	publishConfig := &publish.Config{
@@ -158,11 +156,83 @@ func testServer(tb testing.TB) (*serverenv.ServerEnv, *http.Client) {
 		ReleaseSameDayKeys:       true,
 	}
 
-	publishHandler, err := publish.NewHandler(ctx, publishConfig, env)
+	var publishHandler http.Handler
+	if attestationVerifier != nil {
+		publishHandler, err = publish.NewAttestationGatedHandler(ctx, publishConfig, env, attestationVerifier)
+		if err != nil {
+			return nil, fmt.Errorf("publish.NewAttestationGatedHandler: %w", err)
+		}
+	} else {
+		publishHandler, err = publish.NewHandler(ctx, publishConfig, env)
+		if err != nil {
+			return nil, fmt.Errorf("publish.NewHandler: %w", err)
+		}
+	}
+	mux.Handle("/publish", publishHandler)
+
+	// Signing key rotation
+	rotationConfig := &rotation.Config{
+		Timeout:        10 * time.Minute,
+		KeyMaxAge:      24 * time.Hour,
+		KeyGracePeriod: 24 * time.Hour,
+	}
+
+	rotationHandler, err := rotation.NewHandler(rotationConfig, env)
+	if err != nil {
+		return nil, fmt.Errorf("rotation.NewHandler: %w", err)
+	}
+	mux.Handle("/rotate-signing-keys", rotationHandler)
+
+	return mux, nil
+}
+
+// testServer sets up the local servers used for running tests. When none of
+// the E2E_* environment variables are set it talks to the same in-memory
+// and noop backends as before, so `go test` stays hermetic; when they are
+// set, it talks to the real GCS/KMS/Secret Manager/Postgres backends they
+// describe instead, so the same scenarios can validate a staging
+// environment. requireAttestation forces /publish behind
+// publish.RequireAttestation even when HarnessConfig.RequireAttestation
+// (which only turns on when E2E_REQUIRE_ATTESTATION is "true") is unset,
+// so hermetic tests can exercise that
+// path too; the signer it returns is non-nil whenever attestation ends up
+// gated, by either means.
+func testServer(tb TB, runFolder string, requireAttestation bool) (*serverenv.ServerEnv, *http.Client, *testAttestationSigner) {
+	tb.Helper()
+
+	ctx := context.Background()
+	harnessConfig := loadHarnessConfig()
+
+	aa, err := authorizedapp.NewMemoryProvider(ctx, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	bs := newStorage(ctx, harnessConfig, runFolder, tb)
+	db := newDatabase(ctx, harnessConfig, tb)
+	km := newKeyManager(ctx, harnessConfig, tb)
+	sm := newSecretManager(ctx, harnessConfig, tb)
+
+	env := serverenv.New(ctx,
+		serverenv.WithAuthorizedAppProvider(aa),
+		serverenv.WithBlobStorage(bs),
+		serverenv.WithDatabase(db),
+		serverenv.WithKeyManager(km),
+		serverenv.WithSecretManager(sm),
+	)
+	// Note: don't call env.Cleanup() because the database helper closes the
+	// connection for us.
+
+	var attestationVerifier publish.AttestationVerifier
+	var attestationSigner *testAttestationSigner
+	if harnessConfig.RequireAttestation || requireAttestation {
+		attestationVerifier, attestationSigner = newTestAttestationHarness(tb)
+	}
+
+	mux, err := Routes(ctx, env, attestationVerifier)
 	if err != nil {
 		tb.Fatal(err)
 	}
-	mux.Handle("/publish", publishHandler)
 
 	srv, err := server.New("")
 	if err != nil {
@@ -183,7 +253,7 @@ func testServer(tb testing.TB) (*serverenv.ServerEnv, *http.Client) {
 	// Create a client
 	client := testClient(tb, srv)
 
-	return env, client
+	return env, client, attestationSigner
 }
 
 type prefixRoundTripper struct {
@@ -203,7 +273,7 @@ func (p *prefixRoundTripper) RoundTrip(r *http.Request) (*http.Response, error)
 	return p.rt.RoundTrip(r)
 }
 
-func testClient(tb testing.TB, srv *server.Server) *http.Client {
+func testClient(tb TB, srv *server.Server) *http.Client {
 	prt := &prefixRoundTripper{
 		addr: srv.Addr(),
 		rt:   http.DefaultTransport,
@@ -215,7 +285,7 @@ func testClient(tb testing.TB, srv *server.Server) *http.Client {
 	}
 }
 
-func startAuthorizedApp(ctx context.Context, env *serverenv.ServerEnv, tb testing.TB) {
+func startAuthorizedApp(ctx context.Context, env *serverenv.ServerEnv, tb TB) {
 	aa := env.AuthorizedAppProvider()
 	if err := aa.Add(ctx, &authorizedappmodel.AuthorizedApp{
 		AppPackageName: "com.example.app",
@@ -233,9 +303,19 @@ func startAuthorizedApp(ctx context.Context, env *serverenv.ServerEnv, tb testin
 	}
 }
 
-func createSignatureInfo(ctx context.Context, db *database.DB, exportPeriod time.Duration, tb testing.TB) {
+func createSignatureInfo(ctx context.Context, db *database.DB, exportPeriod time.Duration, config *HarnessConfig, runFolder string, tb TB) (*exportmodel.SignatureInfo, *exportmodel.ExportConfig) {
+	tb.Helper()
+
+	// Against the noop KMS any key name round-trips fine, so keep the
+	// existing fixture name for hermetic runs; against real Cloud KMS the
+	// SignatureInfo has to point at a key version that actually exists.
+	signingKey := "signer"
+	if config.KMS == "gcp" {
+		signingKey = config.SigningKey
+	}
+
 	si := &exportmodel.SignatureInfo{
-		SigningKey:        "signer",
+		SigningKey:        signingKey,
 		SigningKeyVersion: "v1",
 		SigningKeyID:      "US",
 	}
@@ -245,7 +325,7 @@ func createSignatureInfo(ctx context.Context, db *database.DB, exportPeriod time
 
 	// Create an export config.
 	ec := &exportmodel.ExportConfig{
-		BucketName:       exportDir,
+		BucketName:       runFolder,
 		Period:           exportPeriod,
 		OutputRegion:     "TEST",
 		From:             time.Now().Add(-2 * time.Second),
@@ -255,4 +335,21 @@ func createSignatureInfo(ctx context.Context, db *database.DB, exportPeriod time
 	if err := exportdatabase.New(db).AddExportConfig(ctx, ec); err != nil {
 		tb.Fatal(err)
 	}
+
+	return si, ec
+}
+
+// cleanupSignatureInfo removes the SignatureInfo and ExportConfig rows
+// created by createSignatureInfo. It's only used against a real database --
+// the hermetic test database is torn down wholesale instead.
+func cleanupSignatureInfo(ctx context.Context, db *database.DB, si *exportmodel.SignatureInfo, ec *exportmodel.ExportConfig) error {
+	pool := db.Pool()
+
+	if _, err := pool.Exec(ctx, `DELETE FROM export_config WHERE config_id = $1`, ec.ConfigID); err != nil {
+		return fmt.Errorf("deleting export_config row %d: %w", ec.ConfigID, err)
+	}
+	if _, err := pool.Exec(ctx, `DELETE FROM signature_info WHERE id = $1`, si.ID); err != nil {
+		return fmt.Errorf("deleting signature_info row %d: %w", si.ID, err)
+	}
+	return nil
 }
@@ -0,0 +1,83 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/exposure-notifications-server/internal/federationout"
+)
+
+// memoryTokenVerifier is an in-memory federationout.TokenVerifier that
+// accepts only tokens registered via Allow or AllowClaims whose
+// issuer/audience match what was configured, without reaching out to a
+// real JWKS endpoint. It lets tests exercise the
+// audience/issuer allowlist path that production drives off real OIDC
+// tokens.
+type memoryTokenVerifier struct {
+	audience string
+	issuer   string
+
+	// allowed maps raw token strings to the claims they should resolve to,
+	// so individual tests can mint tokens for both the accept and reject
+	// paths without a real signer.
+	allowed map[string]federationout.TokenClaims
+}
+
+// newMemoryTokenVerifier returns a verifier that accepts the given audience
+// and the "TEST" issuer by default.
+func newMemoryTokenVerifier(audience string) *memoryTokenVerifier {
+	return &memoryTokenVerifier{
+		audience: audience,
+		issuer:   "TEST",
+		allowed:  map[string]federationout.TokenClaims{},
+	}
+}
+
+// Allow registers token as valid, resolving to claims identifying
+// healthAuthorityID and carrying this verifier's own audience/issuer --
+// i.e. the claims a real token minted for this verifier would carry.
+func (v *memoryTokenVerifier) Allow(token string, healthAuthorityID int64) {
+	v.AllowClaims(token, federationout.TokenClaims{
+		Issuer:            v.issuer,
+		Audience:          v.audience,
+		HealthAuthorityID: healthAuthorityID,
+	})
+}
+
+// AllowClaims registers token as valid, resolving to claims exactly as
+// given. Unlike Allow, it doesn't force the verifier's own audience/issuer
+// onto the claims, so tests can mint a token whose claims don't match --
+// exercising Verify's audience/issuer rejection paths the same way a
+// misconfigured or malicious peer's token would.
+func (v *memoryTokenVerifier) AllowClaims(token string, claims federationout.TokenClaims) {
+	v.allowed[token] = claims
+}
+
+// Verify implements federationout.TokenVerifier.
+func (v *memoryTokenVerifier) Verify(ctx context.Context, token string) (federationout.TokenClaims, error) {
+	claims, ok := v.allowed[token]
+	if !ok {
+		return federationout.TokenClaims{}, fmt.Errorf("token not recognized")
+	}
+	if claims.Audience != v.audience {
+		return federationout.TokenClaims{}, fmt.Errorf("unexpected audience %q", claims.Audience)
+	}
+	if claims.Issuer != v.issuer {
+		return federationout.TokenClaims{}, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	return claims, nil
+}
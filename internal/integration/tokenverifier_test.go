@@ -0,0 +1,64 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/exposure-notifications-server/internal/federationout"
+)
+
+// TestMemoryTokenVerifier exercises Verify's full allowlist: an unrecognized
+// token, a recognized token whose audience doesn't match, one whose issuer
+// doesn't match, and the accept path. TestFederationOut only ever mints
+// tokens via Allow, whose claims always match the verifier's own
+// audience/issuer by construction, so the mismatch branches need to be
+// covered here directly instead.
+func TestMemoryTokenVerifier(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	v := newMemoryTokenVerifier("https://federationout.example.com")
+
+	v.Allow("good-token", 42)
+	claims, err := v.Verify(ctx, "good-token")
+	if err != nil {
+		t.Fatalf("Verify(good-token): %v", err)
+	}
+	if claims.HealthAuthorityID != 42 {
+		t.Errorf("HealthAuthorityID = %d, want 42", claims.HealthAuthorityID)
+	}
+
+	if _, err := v.Verify(ctx, "unrecognized-token"); err == nil {
+		t.Error("expected an unrecognized token to be rejected")
+	}
+
+	v.AllowClaims("wrong-audience", federationout.TokenClaims{
+		Issuer:   v.issuer,
+		Audience: "https://not-this-peer.example.com",
+	})
+	if _, err := v.Verify(ctx, "wrong-audience"); err == nil {
+		t.Error("expected a token with the wrong audience to be rejected")
+	}
+
+	v.AllowClaims("wrong-issuer", federationout.TokenClaims{
+		Issuer:   "NOT-TEST",
+		Audience: v.audience,
+	})
+	if _, err := v.Verify(ctx, "wrong-issuer"); err == nil {
+		t.Error("expected a token with the wrong issuer to be rejected")
+	}
+}
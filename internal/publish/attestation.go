@@ -0,0 +1,91 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+// AttestationClaims is what a verified attestation token resolves to: the
+// workload measurement the token attests to, plus the standard claims
+// needed to check it was meant for this publish endpoint.
+type AttestationClaims struct {
+	Issuer      string
+	Audience    string
+	Measurement string
+	Nonce       string
+}
+
+// AttestationVerifier verifies a signed attestation token and returns the
+// claims it carries. expectedNonce is the hash of the request body the
+// token's nonce claim must echo, which binds the attestation to this
+// specific upload and prevents replay against a different payload.
+type AttestationVerifier interface {
+	Verify(ctx context.Context, token string, expectedNonce string) (AttestationClaims, error)
+}
+
+// JWKSAttestationVerifier is the default AttestationVerifier. It validates
+// RS256/ES256 tokens against the keys in KeySet, and checks
+// the token's audience, issuer, nonce, and that its measurement claim is in
+// an operator-configured allowlist. It does not fetch or refresh KeySet
+// itself; the caller supplies it, e.g. as read from a JWKS endpoint.
+type JWKSAttestationVerifier struct {
+	KeySet               jwk.Set
+	Issuer               string
+	Audience             string
+	AllowedMeasurements  map[string]struct{}
+	MeasurementClaimName string // defaults to "measurement" if empty
+}
+
+// Verify implements AttestationVerifier.
+func (v *JWKSAttestationVerifier) Verify(ctx context.Context, token string, expectedNonce string) (AttestationClaims, error) {
+	measurementClaim := v.MeasurementClaimName
+	if measurementClaim == "" {
+		measurementClaim = "measurement"
+	}
+
+	parsed, err := jwt.ParseString(token,
+		jwt.WithKeySet(v.KeySet),
+		jwt.WithValidate(true),
+		jwt.WithAudience(v.Audience),
+		jwt.WithIssuer(v.Issuer),
+	)
+	if err != nil {
+		return AttestationClaims{}, fmt.Errorf("verifying attestation token: %w", err)
+	}
+
+	nonce, _ := parsed.Get("nonce")
+	nonceStr, _ := nonce.(string)
+	if nonceStr == "" || nonceStr != expectedNonce {
+		return AttestationClaims{}, fmt.Errorf("attestation token nonce does not match request body")
+	}
+
+	measurement, _ := parsed.Get(measurementClaim)
+	measurementStr, _ := measurement.(string)
+	if _, ok := v.AllowedMeasurements[measurementStr]; !ok {
+		return AttestationClaims{}, fmt.Errorf("attestation measurement %q is not in the allowlist", measurementStr)
+	}
+
+	return AttestationClaims{
+		Issuer:      parsed.Issuer(),
+		Audience:    v.Audience,
+		Measurement: measurementStr,
+		Nonce:       nonceStr,
+	}, nil
+}
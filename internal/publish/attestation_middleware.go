@@ -0,0 +1,85 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/google/exposure-notifications-server/internal/serverenv"
+)
+
+// AttestationHeader is the header an attested client must set to the signed
+// attestation token whose nonce claim echoes the sha256 of the request
+// body.
+const AttestationHeader = "X-Attestation-Token"
+
+// maxAttestationBodyBytes bounds how much of the request body
+// RequireAttestation will buffer in order to hash it; publish bodies are a
+// handful of TEKs and JSON overhead, so this is generous headroom rather
+// than a tight fit.
+const maxAttestationBodyBytes = 1 << 20 // 1 MiB
+
+// RequireAttestation wraps next so that it only runs once the request's
+// X-Attestation-Token header has been verified by verifier. This lets a
+// health authority require that TEK uploads originate from an attested
+// confidential workload rather than from any client bearing an API key.
+func RequireAttestation(verifier AttestationVerifier, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(AttestationHeader)
+		if token == "" {
+			http.Error(w, "missing attestation token", http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxAttestationBodyBytes)
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "request body too large or unreadable", http.StatusBadRequest)
+			return
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		expectedNonce := hex.EncodeToString(sum[:])
+
+		if _, err := verifier.Verify(r.Context(), token, expectedNonce); err != nil {
+			http.Error(w, "attestation verification failed", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NewAttestationGatedHandler builds the publish handler the same way
+// NewHandler does and gates it behind RequireAttestation, so that
+// deployments which require TEK uploads to come from an attested
+// confidential workload have a direct constructor for it instead of having
+// to reassemble the RequireAttestation wiring themselves around
+// NewHandler's result.
+func NewAttestationGatedHandler(ctx context.Context, config *Config, env *serverenv.ServerEnv, verifier AttestationVerifier) (http.Handler, error) {
+	h, err := NewHandler(ctx, config, env)
+	if err != nil {
+		return nil, fmt.Errorf("publish.NewHandler: %w", err)
+	}
+	return RequireAttestation(verifier, h), nil
+}
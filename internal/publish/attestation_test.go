@@ -0,0 +1,210 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+const (
+	testIssuer      = "https://attestation.example.com"
+	testAudience    = "https://publish.example.com"
+	testMeasurement = "sha256:test-workload-measurement"
+)
+
+// testHarness wires up a JWKSAttestationVerifier against a throwaway RSA
+// key, so tests can mint their own tokens without a real attestation
+// service.
+func testHarness(t *testing.T) (*JWKSAttestationVerifier, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := jwk.New(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Set(jwk.AlgorithmKey, jwa.RS256); err != nil {
+		t.Fatal(err)
+	}
+
+	keySet := jwk.NewSet()
+	keySet.Add(pub)
+
+	return &JWKSAttestationVerifier{
+		KeySet:              keySet,
+		Issuer:              testIssuer,
+		Audience:            testAudience,
+		AllowedMeasurements: map[string]struct{}{testMeasurement: {}},
+	}, key
+}
+
+func mintToken(t *testing.T, key *rsa.PrivateKey, measurement, nonce string, ttl time.Duration) string {
+	t.Helper()
+
+	token := jwt.New()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(token.Set(jwt.IssuerKey, testIssuer))
+	must(token.Set(jwt.AudienceKey, testAudience))
+	must(token.Set(jwt.ExpirationKey, time.Now().Add(ttl)))
+	must(token.Set("measurement", measurement))
+	must(token.Set("nonce", nonce))
+
+	signed, err := jwt.Sign(token, jwa.RS256, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(signed)
+}
+
+func nonceFor(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestRequireAttestation_Accept(t *testing.T) {
+	t.Parallel()
+
+	verifier, key := testHarness(t)
+	body := []byte(`{"temporaryExposureKeys":[]}`)
+	token := mintToken(t, key, testMeasurement, nonceFor(body), time.Hour)
+
+	ranNext := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { ranNext = true })
+	handler := RequireAttestation(verifier, next)
+
+	req := httptest.NewRequest(http.MethodPost, "/publish", bytes.NewReader(body))
+	req.Header.Set(AttestationHeader, token)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if !ranNext {
+		t.Errorf("expected next handler to run for a valid attestation token")
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestRequireAttestation_RejectsUnknownMeasurement(t *testing.T) {
+	t.Parallel()
+
+	verifier, key := testHarness(t)
+	body := []byte(`{"temporaryExposureKeys":[]}`)
+	token := mintToken(t, key, "sha256:not-allowlisted", nonceFor(body), time.Hour)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("next handler should not run when the measurement is not allowlisted")
+	})
+	handler := RequireAttestation(verifier, next)
+
+	req := httptest.NewRequest(http.MethodPost, "/publish", bytes.NewReader(body))
+	req.Header.Set(AttestationHeader, token)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", rec.Code)
+	}
+}
+
+func TestRequireAttestation_RejectsExpired(t *testing.T) {
+	t.Parallel()
+
+	verifier, key := testHarness(t)
+	body := []byte(`{"temporaryExposureKeys":[]}`)
+	token := mintToken(t, key, testMeasurement, nonceFor(body), -time.Hour)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("next handler should not run for an expired token")
+	})
+	handler := RequireAttestation(verifier, next)
+
+	req := httptest.NewRequest(http.MethodPost, "/publish", bytes.NewReader(body))
+	req.Header.Set(AttestationHeader, token)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", rec.Code)
+	}
+}
+
+func TestRequireAttestation_RejectsNonceMismatch(t *testing.T) {
+	t.Parallel()
+
+	verifier, key := testHarness(t)
+	body := []byte(`{"temporaryExposureKeys":[]}`)
+	token := mintToken(t, key, testMeasurement, nonceFor([]byte("different body")), time.Hour)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("next handler should not run when the nonce does not match the body")
+	})
+	handler := RequireAttestation(verifier, next)
+
+	req := httptest.NewRequest(http.MethodPost, "/publish", bytes.NewReader(body))
+	req.Header.Set(AttestationHeader, token)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", rec.Code)
+	}
+}
+
+func TestRequireAttestation_RejectsMissingToken(t *testing.T) {
+	t.Parallel()
+
+	verifier, _ := testHarness(t)
+	body := []byte(`{"temporaryExposureKeys":[]}`)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("next handler should not run without an attestation token")
+	})
+	handler := RequireAttestation(verifier, next)
+
+	req := httptest.NewRequest(http.MethodPost, "/publish", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", rec.Code)
+	}
+}
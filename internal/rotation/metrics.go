@@ -0,0 +1,72 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rotation
+
+import (
+	"context"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+)
+
+const metricsPrefix = "rotation"
+
+var (
+	mKeysRotated     = stats.Int64(metricsPrefix+"/keys_rotated_count", "Count of signing keys rotated", stats.UnitDimensionless)
+	mErrors          = stats.Int64(metricsPrefix+"/errors_count", "Count of rotation run errors", stats.UnitDimensionless)
+	mLockContentions = stats.Int64(metricsPrefix+"/lock_contention_count", "Count of rotation runs that found the advisory lock already held by another instance", stats.UnitDimensionless)
+)
+
+func init() {
+	view.Register(
+		&view.View{
+			Name:        mKeysRotated.Name(),
+			Measure:     mKeysRotated,
+			Description: mKeysRotated.Description(),
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        mErrors.Name(),
+			Measure:     mErrors,
+			Description: mErrors.Description(),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        mLockContentions.Name(),
+			Measure:     mLockContentions,
+			Description: mLockContentions.Description(),
+			Aggregation: view.Count(),
+		},
+	)
+}
+
+// recordRotation records the outcome of a single rotation run that got as
+// far as acquiring the advisory lock. Lock contention is recorded
+// separately by recordLockContention -- it's the expected, benign outcome
+// for every non-leader replica on every invocation, and would otherwise
+// drown out mErrors as a signal for genuine failures.
+func recordRotation(ctx context.Context, result rotateResult, err error) {
+	if err != nil {
+		stats.Record(ctx, mErrors.M(1))
+		return
+	}
+	stats.Record(ctx, mKeysRotated.M(int64(result.rotated)))
+}
+
+// recordLockContention records that this run found the advisory lock
+// already held by another instance.
+func recordLockContention(ctx context.Context) {
+	stats.Record(ctx, mLockContentions.M(1))
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rotation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	exportmodel "github.com/google/exposure-notifications-server/internal/export/model"
+)
+
+// errLockHeld is returned when another instance already holds the rotation
+// advisory lock for this interval.
+var errLockHeld = errors.New("rotation: advisory lock already held")
+
+// rotateResult summarizes a single rotation run, and is also what backs the
+// keys-rotated metric.
+type rotateResult struct {
+	rotated int
+}
+
+// doRotate acquires the rotation advisory lock (failing fast if another
+// instance already holds it), finds every SignatureInfo that is still
+// active (EndTimestamp unset) and older than KeyMaxAge, creates a new KMS
+// key version for each, inserts a new active SignatureInfo row pointing at
+// it, points every ExportConfig that referenced the old row at the new one
+// as well (so exports keep signing with both keys through the grace
+// window), and sets the old row's EndTimestamp to now + KeyGracePeriod.
+func (h *Handler) doRotate(ctx context.Context) (result rotateResult, err error) {
+	pool := h.env.Database().Pool()
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return result, fmt.Errorf("acquiring db connection: %w", err)
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, rotationLockID).Scan(&locked); err != nil {
+		return result, fmt.Errorf("acquiring advisory lock: %w", err)
+	}
+	if !locked {
+		recordLockContention(ctx)
+		return result, errLockHeld
+	}
+	defer func() {
+		_, unlockErr := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, rotationLockID)
+		if unlockErr != nil && err == nil {
+			err = fmt.Errorf("releasing advisory lock: %w", unlockErr)
+		}
+	}()
+
+	stale, err := h.staleSignatureInfos(ctx, conn)
+	if err != nil {
+		recordRotation(ctx, result, err)
+		return result, err
+	}
+
+	for _, si := range stale {
+		if err := h.rotateOne(ctx, conn, si); err != nil {
+			recordRotation(ctx, result, err)
+			return result, err
+		}
+		result.rotated++
+	}
+
+	recordRotation(ctx, result, nil)
+	return result, nil
+}
+
+// staleSignatureInfos returns every signature_info row that is still active
+// (end_timestamp IS NULL) and older than the configured KeyMaxAge -- these
+// are the real keys export signs with today, per createSignatureInfo in
+// internal/integration.
+func (h *Handler) staleSignatureInfos(ctx context.Context, conn *pgxpool.Conn) ([]*exportmodel.SignatureInfo, error) {
+	cutoff := time.Now().Add(-h.config.KeyMaxAge)
+
+	rows, err := conn.Query(ctx, `
+		SELECT id, signing_key, signing_key_version, signing_key_id
+		FROM signature_info
+		WHERE end_timestamp IS NULL AND created_at < $1`, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("querying stale signature_info rows: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*exportmodel.SignatureInfo
+	for rows.Next() {
+		si := &exportmodel.SignatureInfo{}
+		if err := rows.Scan(&si.ID, &si.SigningKey, &si.SigningKeyVersion, &si.SigningKeyID); err != nil {
+			return nil, fmt.Errorf("scanning signature_info row: %w", err)
+		}
+		out = append(out, si)
+	}
+	return out, rows.Err()
+}
+
+// rotateOne creates a new KMS key version for si's key, inserts a new
+// active signature_info row pointing at it, adds that new row's id to
+// every export_config that referenced si (so in-flight export periods sign
+// with both the old and new key through the grace window), and schedules
+// si's own end_timestamp for KeyGracePeriod from now.
+func (h *Handler) rotateOne(ctx context.Context, conn *pgxpool.Conn, si *exportmodel.SignatureInfo) error {
+	newVersion, err := h.env.KeyManager().CreateKeyVersion(ctx, si.SigningKey)
+	if err != nil {
+		return fmt.Errorf("creating new key version for %q: %w", si.SigningKey, err)
+	}
+
+	// The insert, the export_config update, and the old row's end_timestamp
+	// update all have to land together: if the process died between the
+	// insert and the end_timestamp update, the next run would see si as
+	// still stale and rotate it again, piling up duplicate signature_info
+	// rows and export_config entries instead of rotating once.
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning rotation transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) // no-op once committed below
+
+	var newID int64
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO signature_info (signing_key, signing_key_version, signing_key_id, created_at)
+		VALUES ($1, $2, $3, now())
+		RETURNING id`, si.SigningKey, newVersion, si.SigningKeyID).Scan(&newID); err != nil {
+		return fmt.Errorf("inserting rotated signature_info row: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE export_config
+		SET signature_info_ids = array_append(signature_info_ids, $1)
+		WHERE $2 = ANY(signature_info_ids)`, newID, si.ID); err != nil {
+		return fmt.Errorf("adding new signature_info %d to export_configs referencing %d: %w", newID, si.ID, err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE signature_info SET end_timestamp = $1 WHERE id = $2`,
+		time.Now().Add(h.config.KeyGracePeriod), si.ID); err != nil {
+		return fmt.Errorf("setting end_timestamp on rotated-out signature_info row %d: %w", si.ID, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing rotation transaction: %w", err)
+	}
+	return nil
+}
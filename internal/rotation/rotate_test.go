@@ -0,0 +1,153 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rotation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-server/internal/database"
+	"github.com/google/exposure-notifications-server/internal/serverenv"
+	"github.com/google/exposure-notifications-server/pkg/keys"
+)
+
+func newTestHandler(t *testing.T, db *database.DB) *Handler {
+	t.Helper()
+
+	km, err := keys.NewNoop(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := serverenv.New(context.Background(),
+		serverenv.WithDatabase(db),
+		serverenv.WithKeyManager(km),
+	)
+
+	return &Handler{
+		config: &Config{
+			Timeout:        10 * time.Second,
+			KeyMaxAge:      time.Hour,
+			KeyGracePeriod: time.Hour,
+		},
+		env: env,
+	}
+}
+
+// insertStaleSignatureInfo inserts a signature_info row old enough for the
+// handler's KeyMaxAge to consider it stale, plus an export_config
+// referencing it, and returns both rows' ids.
+func insertStaleSignatureInfo(t *testing.T, db *database.DB) (signatureInfoID, exportConfigID int64) {
+	t.Helper()
+
+	ctx := context.Background()
+	pool := db.Pool()
+
+	if err := pool.QueryRow(ctx, `
+		INSERT INTO signature_info (signing_key, signing_key_version, signing_key_id, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`, "signer", "v1", "US", time.Now().Add(-2*time.Hour)).Scan(&signatureInfoID); err != nil {
+		t.Fatalf("inserting stale signature_info: %v", err)
+	}
+
+	if err := pool.QueryRow(ctx, `
+		INSERT INTO export_config (bucket_name, period, output_region, from_timestamp, thru_timestamp, signature_info_ids)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING config_id`,
+		"my-bucket", time.Hour, "TEST", time.Now().Add(-time.Hour), time.Now().Add(time.Hour), []int64{signatureInfoID},
+	).Scan(&exportConfigID); err != nil {
+		t.Fatalf("inserting export_config: %v", err)
+	}
+
+	return signatureInfoID, exportConfigID
+}
+
+func TestDoRotate_RotatesStaleKeys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := database.NewTestDatabase(t)
+	h := newTestHandler(t, db)
+
+	siID, ecID := insertStaleSignatureInfo(t, db)
+
+	result, err := h.doRotate(ctx)
+	if err != nil {
+		t.Fatalf("doRotate: %v", err)
+	}
+	if result.rotated != 1 {
+		t.Fatalf("expected 1 key rotated, got %d", result.rotated)
+	}
+
+	pool := db.Pool()
+
+	var endTimestamp *time.Time
+	if err := pool.QueryRow(ctx, `SELECT end_timestamp FROM signature_info WHERE id = $1`, siID).Scan(&endTimestamp); err != nil {
+		t.Fatalf("reading rotated-out signature_info: %v", err)
+	}
+	if endTimestamp == nil || !endTimestamp.After(time.Now()) {
+		t.Errorf("expected end_timestamp to be set in the future, got %v", endTimestamp)
+	}
+
+	var signatureInfoIDs []int64
+	if err := pool.QueryRow(ctx, `SELECT signature_info_ids FROM export_config WHERE config_id = $1`, ecID).Scan(&signatureInfoIDs); err != nil {
+		t.Fatalf("reading export_config: %v", err)
+	}
+	if len(signatureInfoIDs) != 2 {
+		t.Fatalf("expected export_config to reference both the old and new signature_info, got %v", signatureInfoIDs)
+	}
+
+	// Running again immediately must be a no-op: the newly-inserted
+	// signature_info isn't stale, and the rotated-out one is now excluded by
+	// its end_timestamp.
+	result, err = h.doRotate(ctx)
+	if err != nil {
+		t.Fatalf("second doRotate: %v", err)
+	}
+	if result.rotated != 0 {
+		t.Errorf("expected second doRotate to rotate nothing, rotated %d", result.rotated)
+	}
+}
+
+func TestDoRotate_LockContention(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := database.NewTestDatabase(t)
+	h := newTestHandler(t, db)
+
+	insertStaleSignatureInfo(t, db)
+
+	pool := db.Pool()
+	holder, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquiring lock-holding connection: %v", err)
+	}
+	defer holder.Release()
+
+	var locked bool
+	if err := holder.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, rotationLockID).Scan(&locked); err != nil {
+		t.Fatalf("acquiring advisory lock: %v", err)
+	}
+	if !locked {
+		t.Fatal("expected to acquire the advisory lock")
+	}
+	defer holder.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, rotationLockID)
+
+	if _, err := h.doRotate(ctx); err != errLockHeld {
+		t.Fatalf("expected errLockHeld while another connection holds the lock, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rotation rotates the KMS-backed signing keys that back export
+// SignatureInfos, so that operators don't have to rotate them by hand.
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/exposure-notifications-server/internal/serverenv"
+)
+
+// rotationLockID is the Postgres advisory lock key used to ensure only one
+// rotation runs at a time, across however many instances are deployed.
+const rotationLockID = 100200300
+
+// Config configures the signing-key rotation handler.
+type Config struct {
+	// Timeout is the maximum duration a single rotation run is allowed to
+	// take before it is aborted.
+	Timeout time.Duration
+
+	// KeyMaxAge is how old an active SignatureInfo is allowed to get before
+	// it is rotated to a new key version.
+	KeyMaxAge time.Duration
+
+	// KeyGracePeriod is how long a rotated-out SignatureInfo remains valid
+	// for (via its EndTimestamp) so that exports signed with it during the
+	// rotation window still verify.
+	KeyGracePeriod time.Duration
+}
+
+// Handler rotates export signing keys on demand (e.g. on a Cloud Scheduler
+// cron trigger hitting /rotate-signing-keys).
+type Handler struct {
+	config *Config
+	env    *serverenv.ServerEnv
+}
+
+// NewHandler creates a new rotation handler.
+func NewHandler(config *Config, env *serverenv.ServerEnv) (*Handler, error) {
+	if env.KeyManager() == nil {
+		return nil, fmt.Errorf("rotation.NewHandler requires KeyManager")
+	}
+	if env.Database() == nil {
+		return nil, fmt.Errorf("rotation.NewHandler requires Database")
+	}
+
+	return &Handler{config: config, env: env}, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.config.Timeout)
+	defer cancel()
+
+	result, err := h.doRotate(ctx)
+	if err != nil {
+		if err == errLockHeld {
+			// Another instance is already rotating this interval; this is
+			// expected under concurrent invocation and not an error worth
+			// surfacing as a 500.
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintf(w, "rotated %d key(s)\n", result.rotated)
+}